@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+)
+
+// commandTemplateData is the value text/template expands each of a
+// "command" action's Args against.
+type commandTemplateData struct {
+	Src  string
+	Dst  string
+	Name string
+}
+
+// runAction performs the post-quiescence action configured for a rule
+// against a single matched entry. name is the path of the entry relative
+// to the rule's source directory.
+func (w *Watcher) runAction(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("rule %q: refusing to act on invalid entry name %q", w.Name, name)
+	}
+
+	src := filepath.Join(w.Src, name)
+	dst := filepath.Join(w.Dst, name)
+
+	switch w.Action {
+	case "", "move":
+		return moveWithFallback(src, dst, w.Verbose)
+	case "copy":
+		return copyTree(src, dst)
+	case "hardlink":
+		return os.Link(src, dst)
+	case "symlink":
+		return os.Symlink(src, dst)
+	case "command":
+		return w.runCommand(src, dst, name)
+	default:
+		return fmt.Errorf("unknown action %q for rule %q", w.Action, w.Name)
+	}
+}
+
+// runCommand runs w.Command with each of w.Args expanded as a
+// text/template against the entry's source path, destination path and
+// name. Args are passed to the program as discrete argv entries rather
+// than through a shell, so an entry name like "x; rm -rf /" is just a
+// filename, never shell syntax.
+func (w *Watcher) runCommand(src, dst, name string) error {
+	if w.Command == "" {
+		return fmt.Errorf("rule %q has action \"command\" but no command configured", w.Name)
+	}
+
+	data := commandTemplateData{Src: src, Dst: dst, Name: name}
+
+	args := make([]string, len(w.Args))
+	for i, arg := range w.Args {
+		expanded, err := expandCommandArg(arg, data)
+		if err != nil {
+			return fmt.Errorf("expanding arg %d for rule %q: %w", i, w.Name, err)
+		}
+		args[i] = expanded
+	}
+
+	cmd := exec.Command(w.Command, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func expandCommandArg(arg string, data commandTemplateData) (string, error) {
+	tpl, err := template.New("arg").Parse(arg)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandCommandArgPassesMaliciousNameLiterally(t *testing.T) {
+	malicious := []string{
+		"x; rm -rf /",
+		"`id`",
+		"$(id)",
+		"a && echo pwned",
+	}
+
+	for _, name := range malicious {
+		data := commandTemplateData{Name: name}
+		got, err := expandCommandArg("{{.Name}}", data)
+		if err != nil {
+			t.Fatalf("expandCommandArg(%q): %v", name, err)
+		}
+		if got != name {
+			t.Errorf("expandCommandArg(%q) = %q, want unchanged", name, got)
+		}
+	}
+}
+
+func TestRunCommandMaliciousNameNeverReachesShell(t *testing.T) {
+	if _, err := exec.LookPath("touch"); err != nil {
+		t.Skip("touch not available")
+	}
+
+	dir := t.TempDir()
+	name := "x; touch pwned; `id`"
+
+	w := &Watcher{Rule: Rule{
+		Name:    "test",
+		Action:  "command",
+		Command: "touch",
+		Args:    []string{filepath.Join(dir, "{{.Name}}")},
+	}}
+
+	if err := w.runCommand(filepath.Join(dir, "src"), filepath.Join(dir, "dst"), name); err != nil {
+		t.Fatalf("runCommand: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries in %s, want 1: %v", len(entries), dir, entries)
+	}
+	if entries[0].Name() != name {
+		t.Errorf("created entry = %q, want literal %q", entries[0].Name(), name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Error("\"touch pwned\" was executed as a separate shell command")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "fmt"
+
+// Event is a backend-agnostic notification that something changed at
+// Path. Modify and CloseWrite mirror the two fanotify masks volley has
+// always cared about; the inotify backend maps its own event types onto
+// the same fields so callers don't need to know which backend is active.
+type Event struct {
+	Path       string
+	Modify     bool
+	CloseWrite bool
+}
+
+// Backend watches one or more directory trees and reports Events for
+// them. Implementations differ in privilege requirements and exactness:
+// fanotify needs CAP_SYS_ADMIN but watches whole mounts cheaply, while
+// inotify works unprivileged but must track every subdirectory itself.
+type Backend interface {
+	// Mark begins watching root and everything beneath it.
+	Mark(root string) error
+	// Events returns the channel events are delivered on. It is closed
+	// when the backend is closed.
+	Events() <-chan Event
+	Close() error
+}
+
+// NewBackend constructs the backend named by kind ("auto", "fanotify" or
+// "inotify"). "auto" prefers fanotify and falls back to inotify when
+// fanotify initialization fails, which is the common case for
+// unprivileged users and restricted containers.
+func NewBackend(kind string, verbose bool) (Backend, error) {
+	switch kind {
+	case "fanotify":
+		return newFanotifyBackend()
+	case "inotify":
+		return newInotifyBackend()
+	case "", "auto":
+		b, err := newFanotifyBackend()
+		if err == nil {
+			return b, nil
+		}
+		if verbose {
+			fmt.Printf("fanotify unavailable (%v), falling back to inotify\n", err)
+		}
+		return newInotifyBackend()
+	default:
+		return nil, fmt.Errorf("unknown backend %q", kind)
+	}
+}
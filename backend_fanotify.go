@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+	"golang.org/x/sys/unix"
+)
+
+// fanotifyBackend watches whole mounts via fanotify. It requires
+// CAP_SYS_ADMIN; NewBackend falls back to inotify when that's unavailable.
+type fanotifyBackend struct {
+	notify *fanotify.NotifyFD
+	events chan Event
+}
+
+func newFanotifyBackend() (*fanotifyBackend, error) {
+	notify, err := fanotify.Initialize(
+		unix.FAN_CLOEXEC|
+			unix.FAN_UNLIMITED_QUEUE|
+			unix.FAN_UNLIMITED_MARKS,
+		os.O_RDONLY|
+			unix.O_LARGEFILE|
+			unix.O_CLOEXEC,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &fanotifyBackend{
+		notify: notify,
+		events: make(chan Event, 64),
+	}
+	go b.run()
+	return b, nil
+}
+
+func (b *fanotifyBackend) Mark(root string) error {
+	return b.notify.Mark(
+		unix.FAN_MARK_ADD|
+			unix.FAN_MARK_MOUNT,
+		unix.FAN_MODIFY|
+			unix.FAN_CLOSE_WRITE,
+		unix.AT_FDCWD,
+		root,
+	)
+}
+
+func (b *fanotifyBackend) Events() <-chan Event {
+	return b.events
+}
+
+// Close stops the backend by closing the underlying fanotify fd, which
+// unblocks the run loop's pending read with an error. run closes the
+// events channel itself once it has stopped sending on it, so Close
+// never races a concurrent send against the close.
+func (b *fanotifyBackend) Close() error {
+	return b.notify.File.Close()
+}
+
+func (b *fanotifyBackend) run() {
+	defer close(b.events)
+
+	for {
+		data, err := b.notify.GetEvent(os.Getpid())
+		if err != nil {
+			return
+		}
+		if data == nil {
+			continue
+		}
+
+		path, err := data.GetPath()
+		if err != nil {
+			data.Close()
+			continue
+		}
+
+		b.events <- Event{
+			Path:       path,
+			Modify:     data.MatchMask(unix.FAN_MODIFY),
+			CloseWrite: data.MatchMask(unix.FAN_CLOSE_WRITE),
+		}
+		data.Close()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyBackend watches a tree without needing CAP_SYS_ADMIN by
+// recursively adding an inotify watch to every subdirectory and keeping
+// that set up to date as directories are created and removed.
+type inotifyBackend struct {
+	fd     int
+	events chan Event
+
+	mu      sync.Mutex
+	wdPaths map[int32]string // watch descriptor -> directory path
+}
+
+const inotifyWatchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY |
+	unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_DELETE_SELF
+
+func newInotifyBackend() (*inotifyBackend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &inotifyBackend{
+		fd:      fd,
+		events:  make(chan Event, 64),
+		wdPaths: make(map[int32]string),
+	}
+	go b.run()
+	return b, nil
+}
+
+// Mark recursively watches root and every subdirectory beneath it.
+func (b *inotifyBackend) Mark(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return b.addWatch(path)
+		}
+		return nil
+	})
+}
+
+func (b *inotifyBackend) addWatch(dir string) error {
+	wd, err := unix.InotifyAddWatch(b.fd, dir, inotifyWatchMask)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.wdPaths[int32(wd)] = dir
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *inotifyBackend) removeWatch(wd int32) {
+	b.mu.Lock()
+	delete(b.wdPaths, wd)
+	b.mu.Unlock()
+}
+
+func (b *inotifyBackend) Events() <-chan Event {
+	return b.events
+}
+
+// Close stops the backend by closing the inotify fd, which unblocks
+// run's pending read with an error. run closes the events channel
+// itself once it has stopped sending on it, so Close never races a
+// concurrent send against the close.
+func (b *inotifyBackend) Close() error {
+	return unix.Close(b.fd)
+}
+
+func (b *inotifyBackend) run() {
+	defer close(b.events)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.PathMax+1))
+
+	for {
+		n, err := unix.Read(b.fd, buf)
+		if err != nil || n <= 0 {
+			return
+		}
+
+		offset := 0
+		for offset+unix.SizeofInotifyEvent <= n {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameLen := int(raw.Len)
+
+			var name string
+			if nameLen > 0 {
+				name = trimNulls(string(buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+nameLen]))
+			}
+			offset += unix.SizeofInotifyEvent + nameLen
+
+			b.mu.Lock()
+			dir, ok := b.wdPaths[raw.Wd]
+			b.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			path := dir
+			if name != "" {
+				path = filepath.Join(dir, name)
+			}
+
+			mask := raw.Mask
+			if mask&unix.IN_IGNORED != 0 {
+				b.removeWatch(raw.Wd)
+				continue
+			}
+			if mask&unix.IN_ISDIR != 0 && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				// Newly appeared subdirectory: watch it too, and treat its
+				// appearance as an event on itself so callers see it.
+				_ = b.addWatch(path)
+			}
+
+			b.events <- Event{
+				Path:       path,
+				Modify:     mask&unix.IN_MODIFY != 0,
+				CloseWrite: mask&unix.IN_CLOSE_WRITE != 0,
+			}
+		}
+	}
+}
+
+func trimNulls(s string) string {
+	for i, r := range s {
+		if r == 0 {
+			return s[:i]
+		}
+	}
+	return s
+}
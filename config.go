@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule describes a single independent watch: a source/destination pair,
+// its own quiescence window, include/exclude filters and the action to
+// take once a matched entry goes quiet.
+type Rule struct {
+	Name    string   `yaml:"name" toml:"name"`
+	Src     string   `yaml:"src" toml:"src"`
+	Dst     string   `yaml:"dst" toml:"dst"`
+	Wait    int      `yaml:"wait" toml:"wait"`
+	Include []string `yaml:"include" toml:"include"`
+	Exclude []string `yaml:"exclude" toml:"exclude"`
+	// Action is one of "move" (default), "copy", "hardlink", "symlink" or "command".
+	// Command is the "command" action's program to run; Args are its
+	// arguments, each expanded as a text/template against {{.Src}},
+	// {{.Dst}} and {{.Name}} and passed to the program directly (no
+	// shell involved, so entry names can't inject extra commands).
+	Action  string   `yaml:"action" toml:"action"`
+	Command string   `yaml:"command" toml:"command"`
+	Args    []string `yaml:"args" toml:"args"`
+	Verbose bool     `yaml:"verbose" toml:"verbose"`
+
+	// StableChecks, if greater than zero, requires the entry's size,
+	// mtime and (for directories) file count to stay identical across
+	// this many samples, StableInterval (seconds) apart, before the
+	// action runs.
+	StableChecks   int `yaml:"stable_checks" toml:"stable_checks"`
+	StableInterval int `yaml:"stable_interval" toml:"stable_interval"`
+}
+
+// Config is the top level shape of a -config file: a flat list of rules,
+// each watched independently.
+type Config struct {
+	Rules []Rule `yaml:"rules" toml:"rules"`
+}
+
+// LoadConfig reads and parses a config file describing one or more watch
+// rules. Files named *.toml are parsed as TOML; everything else
+// (including *.yaml/*.yml and extensionless paths) is parsed as YAML.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	var cfg Config
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		if err := toml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	} else if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+
+	if len(cfg.Rules) == 0 {
+		return nil, fmt.Errorf("config %s defines no rules", path)
+	}
+
+	for i := range cfg.Rules {
+		if cfg.Rules[i].Name == "" {
+			cfg.Rules[i].Name = fmt.Sprintf("rule%d", i)
+		}
+		if cfg.Rules[i].Wait <= 0 {
+			cfg.Rules[i].Wait = 120
+		}
+		if cfg.Rules[i].Action == "" {
+			cfg.Rules[i].Action = "move"
+		}
+	}
+
+	return &cfg, nil
+}
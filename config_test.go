@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yaml")
+	writeFile(t, path, `
+rules:
+  - src: /tmp/a
+    dst: /tmp/b
+  - name: uploads
+    src: /tmp/c
+    dst: /tmp/d
+    wait: 30
+    action: copy
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(cfg.Rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(cfg.Rules))
+	}
+
+	if cfg.Rules[0].Name != "rule0" {
+		t.Errorf("rule 0 name = %q, want default \"rule0\"", cfg.Rules[0].Name)
+	}
+	if cfg.Rules[0].Wait != 120 {
+		t.Errorf("rule 0 wait = %d, want default 120", cfg.Rules[0].Wait)
+	}
+	if cfg.Rules[0].Action != "move" {
+		t.Errorf("rule 0 action = %q, want default \"move\"", cfg.Rules[0].Action)
+	}
+
+	if cfg.Rules[1].Name != "uploads" {
+		t.Errorf("rule 1 name = %q, want \"uploads\"", cfg.Rules[1].Name)
+	}
+	if cfg.Rules[1].Wait != 30 {
+		t.Errorf("rule 1 wait = %d, want 30", cfg.Rules[1].Wait)
+	}
+	if cfg.Rules[1].Action != "copy" {
+		t.Errorf("rule 1 action = %q, want \"copy\"", cfg.Rules[1].Action)
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.toml")
+	writeFile(t, path, `
+[[rules]]
+name = "downloads"
+src = "/tmp/a"
+dst = "/tmp/b"
+action = "hardlink"
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(cfg.Rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(cfg.Rules))
+	}
+	if cfg.Rules[0].Name != "downloads" {
+		t.Errorf("name = %q, want \"downloads\"", cfg.Rules[0].Name)
+	}
+	if cfg.Rules[0].Action != "hardlink" {
+		t.Errorf("action = %q, want \"hardlink\"", cfg.Rules[0].Action)
+	}
+}
+
+func TestLoadConfigNoRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.yaml")
+	writeFile(t, path, "rules: []\n")
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("LoadConfig with no rules: want error, got nil")
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyBufferSize is the buffer size used when streaming file contents
+// during a copy, set via -copy-buffer.
+var copyBufferSize = 1 << 20 // 1 MiB
+
+// moveWithFallback renames src to dst, falling back to a recursive
+// copy-then-rename when src and dst live on different filesystems
+// (EXDEV). The fallback copies into a temporary sibling of dst, fsyncs
+// everything, atomically renames into place, and only then removes src.
+func moveWithFallback(src, dst string, verbose bool) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if verbose {
+		fmt.Printf("cross-filesystem move detected for %s, falling back to copy+rename\n", src)
+	}
+
+	tmp, err := tempSibling(dst)
+	if err != nil {
+		return fmt.Errorf("choosing temp path for %s: %w", dst, err)
+	}
+
+	if err := copyTreeSynced(src, tmp, verbose); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("copying %s to %s: %w", src, tmp, err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("renaming %s to %s: %w", tmp, dst, err)
+	}
+
+	if err := fsyncParent(dst); err != nil {
+		return fmt.Errorf("fsyncing parent of %s: %w", dst, err)
+	}
+
+	return os.RemoveAll(src)
+}
+
+// tempSibling returns dst + ".volley-tmp-<random>", a name on the same
+// filesystem as dst that the copy can build up before the final rename.
+func tempSibling(dst string) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return dst + ".volley-tmp-" + hex.EncodeToString(buf), nil
+}
+
+// copyTree copies src to dst, recursing into directories. It is used by
+// the "copy" action directly, and by moveWithFallback's cross-filesystem
+// path via copyTreeSynced.
+func copyTree(src, dst string) error {
+	return copyTreeSynced(src, dst, false)
+}
+
+// copyTreeSynced recursively copies src to dst, preserving mode,
+// ownership (when running as root), mtime and xattrs, recreating
+// symlinks rather than following them, and fsyncing every regular file
+// and directory it creates.
+func copyTreeSynced(src, dst string, verbose bool) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return copySymlink(src, dst, info)
+	case info.IsDir():
+		return copyDirSynced(src, dst, info, verbose)
+	default:
+		if verbose {
+			fmt.Printf("copying %s -> %s (%d bytes)\n", src, dst, info.Size())
+		}
+		return copyFileSynced(src, dst, info)
+	}
+}
+
+func copyDirSynced(src, dst string, info os.FileInfo, verbose bool) error {
+	// Create with a writable mode regardless of the source's final mode
+	// (e.g. 0o555 on a "finished" read-only tree) so children can still
+	// be created inside it; preserveMetadata below chmods it to match
+	// src once the recursion is done.
+	if err := os.MkdirAll(dst, 0o700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		srcPath := filepath.Join(src, entry.Name())
+		dstPath := filepath.Join(dst, entry.Name())
+		if err := copyTreeSynced(srcPath, dstPath, verbose); err != nil {
+			return err
+		}
+	}
+
+	if err := preserveMetadata(src, dst, info); err != nil {
+		return err
+	}
+	return fsyncPath(dst)
+}
+
+func copyFileSynced(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.CopyBuffer(out, in, make([]byte, copyBufferSize)); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return preserveMetadata(src, dst, info)
+}
+
+func copySymlink(src, dst string, info os.FileInfo) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+	return preserveOwnership(src, dst, info, true)
+}
+
+// preserveMetadata copies mode, ownership, mtime and xattrs from src to
+// dst. It is a no-op for fields that don't apply (e.g. ownership when
+// not running as root).
+func preserveMetadata(src, dst string, info os.FileInfo) error {
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := preserveOwnership(src, dst, info, false); err != nil {
+		return err
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return copyXattrs(src, dst)
+}
+
+func preserveOwnership(src, dst string, info os.FileInfo, isSymlink bool) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if isSymlink {
+		return os.Lchown(dst, int(stat.Uid), int(stat.Gid))
+	}
+	return os.Chown(dst, int(stat.Uid), int(stat.Gid))
+}
+
+func copyXattrs(src, dst string) error {
+	names, err := unix.Llistxattr(src, nil)
+	if err != nil {
+		// Filesystems without xattr support are common; don't fail the copy.
+		return nil
+	}
+
+	buf := make([]byte, names)
+	n, err := unix.Llistxattr(src, buf)
+	if err != nil {
+		return nil
+	}
+
+	for _, name := range splitXattrNames(buf[:n]) {
+		size, err := unix.Lgetxattr(src, name, nil)
+		if err != nil {
+			continue
+		}
+		val := make([]byte, size)
+		if _, err := unix.Lgetxattr(src, name, val); err != nil {
+			continue
+		}
+		_ = unix.Lsetxattr(dst, name, val, 0)
+	}
+	return nil
+}
+
+func splitXattrNames(buf []byte) []string {
+	var names []string
+	start := 0
+	for i, b := range buf {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
+
+func fsyncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func fsyncParent(path string) error {
+	return fsyncPath(filepath.Dir(path))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyTreeFilePreservesModeAndMtime(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dst := filepath.Join(dir, "dst.txt")
+
+	if err := os.WriteFile(src, []byte("payload"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dstInfo.Mode().Perm() != srcInfo.Mode().Perm() {
+		t.Errorf("dst mode = %v, want %v", dstInfo.Mode().Perm(), srcInfo.Mode().Perm())
+	}
+	if !dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		t.Errorf("dst mtime = %v, want %v", dstInfo.ModTime(), srcInfo.ModTime())
+	}
+
+	content, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "payload" {
+		t.Errorf("dst content = %q, want \"payload\"", content)
+	}
+}
+
+func TestCopyTreeDirRecurses(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	if err := os.MkdirAll(filepath.Join(src, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "nested", "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "nested", "a.txt"))
+	if err != nil {
+		t.Fatalf("reading copied file: %v", err)
+	}
+	if string(content) != "a" {
+		t.Errorf("content = %q, want \"a\"", content)
+	}
+}
+
+func TestCopyTreeDirReadOnlySource(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(src, 0o755)
+
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "a.txt"))
+	if err != nil {
+		t.Fatalf("reading copied file: %v", err)
+	}
+	if string(content) != "a" {
+		t.Errorf("content = %q, want \"a\"", content)
+	}
+
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dstInfo.Mode().Perm() != 0o555 {
+		t.Errorf("dst mode = %v, want %v", dstInfo.Mode().Perm(), os.FileMode(0o555))
+	}
+}
+
+func TestCopyTreeSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	if err := os.WriteFile(target, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "link-copy")
+	if err := copyTree(link, dst); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+
+	got, err := os.Readlink(dst)
+	if err != nil {
+		t.Fatalf("dst isn't a symlink: %v", err)
+	}
+	if got != target {
+		t.Errorf("link target = %q, want %q", got, target)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// statusEntry is the JSON shape of a single tracked entry returned by
+// /status. Bytes and Mtime are a fresh on-disk sample, not a cached
+// value, so they reflect the entry's state at the moment of the request.
+type statusEntry struct {
+	Rule      string        `json:"rule"`
+	Name      string        `json:"name"`
+	FirstSeen time.Time     `json:"first_seen"`
+	Remaining time.Duration `json:"remaining_ns"`
+	Bytes     int64         `json:"bytes"`
+	Mtime     time.Time     `json:"mtime"`
+}
+
+// serveAdmin starts the admin/status HTTP server and blocks until it
+// exits. It's started in its own goroutine by main when -listen is set.
+func serveAdmin(addr string, watchers []*Watcher) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		handleStatus(w, watchers)
+	})
+	mux.HandleFunc("/flush", func(w http.ResponseWriter, r *http.Request) {
+		handleFlushOrCancel(w, r, watchers, (*Watcher).flush)
+	})
+	mux.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
+		handleFlushOrCancel(w, r, watchers, (*Watcher).cancel)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(writePrometheus(watchers)))
+	})
+
+	log.Printf("admin server listening on %s\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("admin server exited: %v\n", err)
+	}
+}
+
+func handleStatus(w http.ResponseWriter, watchers []*Watcher) {
+	now := time.Now()
+	var entries []statusEntry
+
+	for _, watcher := range watchers {
+		watcher.mu.Lock()
+		names := make(map[string]*trackedEntry, len(watcher.timers))
+		for name, entry := range watcher.timers {
+			names[name] = entry
+		}
+		watcher.mu.Unlock()
+
+		for name, entry := range names {
+			status := statusEntry{
+				Rule:      watcher.Name,
+				Name:      name,
+				FirstSeen: entry.firstSeen,
+				Remaining: entry.deadline.Sub(now),
+			}
+
+			// Best-effort: the entry may have been removed between the
+			// lock above and this sample, so a stat error just leaves
+			// Bytes/Mtime at their zero values.
+			if sample, err := sampleTree(filepath.Join(watcher.Src, name)); err == nil {
+				status.Bytes = sample.size
+				status.Mtime = sample.mtime
+			}
+
+			entries = append(entries, status)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleFlushOrCancel backs both /flush and /cancel: both take a
+// `path` query parameter identifying the entry (the full path under a
+// rule's source directory), find the owning watcher by longest-prefix
+// match and the entry's name within it, then apply op.
+func handleFlushOrCancel(w http.ResponseWriter, r *http.Request, watchers []*Watcher, op func(*Watcher, string) bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "missing path query parameter", http.StatusBadRequest)
+		return
+	}
+
+	watcher := matchWatcher(watchers, path)
+	if watcher == nil {
+		http.Error(w, "no rule watches that path", http.StatusNotFound)
+		return
+	}
+
+	name := getWatchComponent(path, watcher.Src)
+	if !op(watcher, name) {
+		http.Error(w, "no pending entry for that path", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -4,39 +4,25 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
-	"sync"
-	"time"
-
-	"github.com/s3rj1k/go-fanotify/fanotify"
-	"golang.org/x/sys/unix"
+	"syscall"
 )
 
 var (
-	timers          = make(map[string]*time.Timer)
+	configPath      string
 	sourcePath      string
 	destinationPath string
 	verbose         bool
 	waitTime        int
-	waitFor         time.Duration
-	mu              sync.Mutex
-	callback        = func(path string) {
-		fmt.Println("Timer expired, moving file or directory:", path)
-		src := filepath.Join(sourcePath, path)
-		dst := filepath.Join(destinationPath, path)
-
-		err := os.Rename(src, dst)
-		if err != nil {
-			fmt.Printf("Error moving %v to %v: %v", src, dst, err)
-		}
-
-		mu.Lock()
-		delete(timers, path)
-		mu.Unlock()
-	}
+	stableChecks    int
+	stableInterval  int
+	backendName     string
+	listenAddr      string
+	statePath       string
 )
 
 func validateExistingDir(path string) bool {
@@ -49,111 +35,155 @@ func validateExistingDir(path string) bool {
 	return true
 }
 
-func main() {
-	flag.StringVar(&sourcePath, "src", "", "Source path")
-	flag.StringVar(&destinationPath, "dst", "", "Destination path")
-	flag.BoolVar(&verbose, "verbose", false, "Verbose logging")
-	flag.IntVar(&waitTime, "wait", 120, "Number of seconds to wait for more events before moving files")
-
-	flag.Parse()
+// loadRules builds the set of rules to watch, either from a -config file
+// or, for the single-rule case, from the legacy -src/-dst/-wait flags.
+func loadRules() ([]Rule, error) {
+	if configPath != "" {
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.Rules, nil
+	}
 
 	if sourcePath == "" || destinationPath == "" {
-		log.Fatalf("Error: source and destination path has to be specified.")
+		return nil, fmt.Errorf("either -config or both -src and -dst must be specified")
 	}
 
-	waitFor = time.Duration(waitTime) * time.Second
+	return []Rule{{
+		Name:           "default",
+		Src:            sourcePath,
+		Dst:            destinationPath,
+		Wait:           waitTime,
+		Verbose:        verbose,
+		Action:         "move",
+		StableChecks:   stableChecks,
+		StableInterval: stableInterval,
+	}}, nil
+}
 
-	if !validateExistingDir(sourcePath) || !validateExistingDir(destinationPath) {
-		log.Fatalf("Error: source and destination path must exist and be directories.")
+// applyStabilityDefaults fills in the -stable-checks/-stable-interval
+// flags for any rule that doesn't set its own.
+func applyStabilityDefaults(rules []Rule) {
+	for i := range rules {
+		if rules[i].StableChecks == 0 {
+			rules[i].StableChecks = stableChecks
+		}
+		if rules[i].StableInterval == 0 {
+			rules[i].StableInterval = stableInterval
+		}
 	}
+}
 
-	fmt.Println("Watching directory", sourcePath, "and moving to", destinationPath)
+func main() {
+	flag.StringVar(&configPath, "config", "", "Path to a YAML config file defining one or more watch rules")
+	flag.StringVar(&sourcePath, "src", "", "Source path (ignored if -config is set)")
+	flag.StringVar(&destinationPath, "dst", "", "Destination path (ignored if -config is set)")
+	flag.BoolVar(&verbose, "verbose", false, "Verbose logging")
+	flag.IntVar(&waitTime, "wait", 120, "Number of seconds to wait for more events before moving files")
+	flag.IntVar(&copyBufferSize, "copy-buffer", copyBufferSize, "Buffer size in bytes used when copying across filesystems")
+	flag.IntVar(&stableChecks, "stable-checks", 0, "Number of consecutive samples an entry's size/mtime/file count must match before acting on it (0 disables)")
+	flag.IntVar(&stableInterval, "stable-interval", 2, "Seconds to wait between stability samples")
+	flag.StringVar(&backendName, "backend", "auto", "Event backend to use: auto, fanotify or inotify")
+	flag.StringVar(&listenAddr, "listen", "", "Address to serve the admin/status HTTP endpoints on, e.g. :8080 (disabled if empty)")
+	flag.StringVar(&statePath, "state", "", "Path to a JSON file used to persist pending entries across restarts (disabled if empty)")
 
-	notify, err := fanotify.Initialize(
-		unix.FAN_CLOEXEC|
-			unix.FAN_UNLIMITED_QUEUE|
-			unix.FAN_UNLIMITED_MARKS,
-		os.O_RDONLY|
-			unix.O_LARGEFILE|
-			unix.O_CLOEXEC,
-	)
+	flag.Parse()
 
+	rules, err := loadRules()
 	if err != nil {
-		log.Fatalf("%v\n", err)
+		log.Fatalf("Error: %v\n", err)
 	}
+	applyStabilityDefaults(rules)
 
-	if err = notify.Mark(
-		unix.FAN_MARK_ADD|
-			unix.FAN_MARK_MOUNT,
-		unix.FAN_MODIFY|
-			unix.FAN_CLOSE_WRITE,
-		unix.AT_FDCWD,
-		sourcePath,
-	); err != nil {
-		log.Fatalf("%v\n", err)
+	watchers := make([]*Watcher, 0, len(rules))
+	for _, r := range rules {
+		w, err := NewWatcher(r)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		watchers = append(watchers, w)
+		fmt.Printf("[%s] watching %s and running %q action into %s\n", w.Name, w.Src, actionLabel(w.Action), w.Dst)
 	}
 
-	for {
-		data, err := notify.GetEvent(os.Getpid())
+	// Sort by source path length, longest first, so that demuxing an event
+	// picks the most specific rule whose source path prefixes it.
+	sort.Slice(watchers, func(i, j int) bool {
+		return len(watchers[i].Src) > len(watchers[j].Src)
+	})
+
+	if statePath != "" {
+		entries, err := LoadState(statePath)
 		if err != nil {
-			log.Fatalf("Error: %v\n", err)
+			log.Fatalf("loading state %s: %v\n", statePath, err)
 		}
+		RestoreState(entries, watchers)
+	}
 
-		if data == nil {
-			continue
+	for _, w := range watchers {
+		if err := w.rescan(); err != nil {
+			log.Printf("rescanning %s for rule %q: %v\n", w.Src, w.Name, err)
 		}
+	}
 
-		path, err := data.GetPath()
-		if err != nil {
-			log.Fatalf("Error getting path for event. %v\n", err)
+	backend, err := NewBackend(backendName, verbose)
+	if err != nil {
+		log.Fatalf("initializing %s backend: %v\n", backendName, err)
+	}
+
+	for _, w := range watchers {
+		if err := backend.Mark(w.Src); err != nil {
+			log.Fatalf("marking %s: %v\n", w.Src, err)
 		}
+	}
+
+	if listenAddr != "" {
+		go serveAdmin(listenAddr, watchers)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Printf("received %s, shutting down\n", sig)
+		backend.Close()
+	}()
+
+	for event := range backend.Events() {
+		recordEvent(event)
 
-		// Filter out events not related to our source path
-		if !strings.HasPrefix(path, sourcePath) {
-			data.Close()
+		w := matchWatcher(watchers, event.Path)
+		if w == nil {
 			continue
 		}
 
-		if verbose {
-			fmt.Println("Received an event for", path)
+		if w.Verbose {
+			fmt.Printf("[%s] received an event for %s\n", w.Name, event.Path)
 		}
 
-		if data.MatchMask(unix.FAN_CLOSE_WRITE) || data.MatchMask(unix.FAN_MODIFY) {
-			name := getWatchComponent(path, sourcePath)
-			mu.Lock()
-			timer, ok := timers[name]
-			mu.Unlock()
-
-			// If no timer exists yet, create one
-			if !ok {
-				fmt.Println("New content detected, watching:", name)
-				timer = time.AfterFunc(math.MaxInt64, func() { callback(name) })
-				timer.Stop()
-
-				mu.Lock()
-				timers[name] = timer
-				mu.Unlock()
-			}
-
-			// An event was registered, so reset the timer
-			if verbose {
-				fmt.Println("Received an event, so resetting the timer for", name)
-			}
-			timer.Reset(waitFor)
+		if event.Modify || event.CloseWrite {
+			w.handleEvent(event.Path)
 		}
-		data.Close()
 	}
-}
 
-// Returns either the filename (if path refers to a file in the root of basePath directory)
-// or the first directory component of path relative to basePath (if the path is in a subdirectory of basePath)
-func getWatchComponent(path, basePath string) string {
-	dir, fname := filepath.Split(path)
-	relPath, _ := filepath.Rel(basePath, dir)
+	if statePath != "" {
+		if err := SaveState(statePath, watchers); err != nil {
+			log.Printf("saving state to %s: %v\n", statePath, err)
+		} else {
+			log.Printf("saved pending state to %s\n", statePath)
+		}
+	}
+}
 
-	if relPath == "." {
-		return fname
-	} else {
-		return strings.Split(relPath, "/")[0]
+// matchWatcher finds the watcher whose source path is the longest-prefix
+// match for path. watchers must be sorted longest-source-first. The
+// match is on path segments, not raw strings, so a rule watching
+// /data/foo never matches an unrelated sibling like /data/foobar.
+func matchWatcher(watchers []*Watcher, path string) *Watcher {
+	for _, w := range watchers {
+		if path == w.Src || strings.HasPrefix(path, w.Src+string(filepath.Separator)) {
+			return w
+		}
 	}
+	return nil
 }
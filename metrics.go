@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// metrics holds the process-wide counters exposed on /metrics. All
+// fields are updated with the sync/atomic package so they can be read
+// and written from the event loop, timers and the admin HTTP server
+// without a mutex.
+var metrics = struct {
+	eventsModify     uint64
+	eventsCloseWrite uint64
+	movesSucceeded   uint64
+	movesFailed      uint64
+	waitHistogram    waitHistogram
+}{}
+
+func recordEvent(e Event) {
+	if e.Modify {
+		atomic.AddUint64(&metrics.eventsModify, 1)
+	}
+	if e.CloseWrite {
+		atomic.AddUint64(&metrics.eventsCloseWrite, 1)
+	}
+}
+
+func recordActionResult(err error) {
+	if err != nil {
+		atomic.AddUint64(&metrics.movesFailed, 1)
+		return
+	}
+	atomic.AddUint64(&metrics.movesSucceeded, 1)
+}
+
+// waitHistogramBuckets are the upper bounds, in seconds, of the
+// cumulative buckets used for the volley_wait_seconds histogram.
+// numWaitHistogramBuckets must match len(waitHistogramBuckets); array
+// lengths need a real constant, not a function of the slice var.
+const numWaitHistogramBuckets = 9
+
+var waitHistogramBuckets = [numWaitHistogramBuckets]float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+type waitHistogram struct {
+	counts  [numWaitHistogramBuckets]uint64
+	sumBits uint64
+	count   uint64
+}
+
+func (h *waitHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, bound := range waitHistogramBuckets {
+		if seconds <= bound {
+			atomic.AddUint64(&h.counts[i], 1)
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+	addFloat(&h.sumBits, seconds)
+}
+
+func addFloat(bits *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		newVal := math.Float64bits(bitsToFloat(old) + delta)
+		if atomic.CompareAndSwapUint64(bits, old, newVal) {
+			return
+		}
+	}
+}
+
+func bitsToFloat(bits uint64) float64 {
+	return math.Float64frombits(bits)
+}
+
+func recordWait(d time.Duration) {
+	metrics.waitHistogram.observe(d)
+}
+
+// pendingCount returns the number of entries currently being tracked
+// across all watchers.
+func pendingCount(watchers []*Watcher) int {
+	total := 0
+	for _, w := range watchers {
+		w.mu.Lock()
+		total += len(w.timers)
+		w.mu.Unlock()
+	}
+	return total
+}
+
+// writePrometheus renders all metrics in the Prometheus text exposition
+// format.
+func writePrometheus(watchers []*Watcher) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# HELP volley_events_total Backend events received, by mask.\n")
+	fmt.Fprintf(&b, "# TYPE volley_events_total counter\n")
+	fmt.Fprintf(&b, "volley_events_total{mask=\"modify\"} %d\n", atomic.LoadUint64(&metrics.eventsModify))
+	fmt.Fprintf(&b, "volley_events_total{mask=\"close_write\"} %d\n", atomic.LoadUint64(&metrics.eventsCloseWrite))
+
+	fmt.Fprintf(&b, "# HELP volley_moves_total Post-quiescence actions, by result.\n")
+	fmt.Fprintf(&b, "# TYPE volley_moves_total counter\n")
+	fmt.Fprintf(&b, "volley_moves_total{result=\"success\"} %d\n", atomic.LoadUint64(&metrics.movesSucceeded))
+	fmt.Fprintf(&b, "volley_moves_total{result=\"failure\"} %d\n", atomic.LoadUint64(&metrics.movesFailed))
+
+	fmt.Fprintf(&b, "# HELP volley_pending_entries Entries currently waiting for quiescence.\n")
+	fmt.Fprintf(&b, "# TYPE volley_pending_entries gauge\n")
+	fmt.Fprintf(&b, "volley_pending_entries %d\n", pendingCount(watchers))
+
+	fmt.Fprintf(&b, "# HELP volley_wait_seconds How long entries waited before their action ran.\n")
+	fmt.Fprintf(&b, "# TYPE volley_wait_seconds histogram\n")
+	h := &metrics.waitHistogram
+	for i, bound := range waitHistogramBuckets {
+		fmt.Fprintf(&b, "volley_wait_seconds_bucket{le=\"%g\"} %d\n", bound, atomic.LoadUint64(&h.counts[i]))
+	}
+	fmt.Fprintf(&b, "volley_wait_seconds_bucket{le=\"+Inf\"} %d\n", atomic.LoadUint64(&h.count))
+	fmt.Fprintf(&b, "volley_wait_seconds_sum %g\n", bitsToFloat(atomic.LoadUint64(&h.sumBits)))
+	fmt.Fprintf(&b, "volley_wait_seconds_count %d\n", atomic.LoadUint64(&h.count))
+
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// treeSample is a cheap fingerprint of a file or directory tree: total
+// size, newest mtime and file count. Two identical samples taken apart
+// in time are a strong signal that nothing is still writing to the tree.
+type treeSample struct {
+	size  int64
+	mtime time.Time
+	count int
+}
+
+func sampleTree(root string) (treeSample, error) {
+	var s treeSample
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		s.count++
+		s.size += info.Size()
+		if info.ModTime().After(s.mtime) {
+			s.mtime = info.ModTime()
+		}
+		return nil
+	})
+
+	return s, err
+}
+
+// waitUntilStable blocks until StableChecks consecutive samples of path,
+// StableInterval apart, are identical. It re-polls from scratch whenever
+// a sample differs from the previous one, so a still-writing tree never
+// passes. A stat error (e.g. the entry was removed or renamed away
+// mid-poll) ends the wait so the caller can decide what to do.
+func (w *Watcher) waitUntilStable(path string) error {
+	if w.StableChecks <= 0 {
+		return nil
+	}
+
+	interval := time.Duration(w.StableInterval) * time.Second
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	prev, err := sampleTree(path)
+	if err != nil {
+		return err
+	}
+
+	matched := 1
+	for matched < w.StableChecks {
+		time.Sleep(interval)
+
+		cur, err := sampleTree(path)
+		if err != nil {
+			return err
+		}
+
+		if cur == prev {
+			matched++
+			continue
+		}
+
+		if w.Verbose {
+			fmt.Printf("[%s] %s still changing, resetting stability count\n", w.Name, path)
+		}
+		prev = cur
+		matched = 1
+	}
+
+	return nil
+}
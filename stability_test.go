@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleTreeFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sample, err := sampleTree(path)
+	if err != nil {
+		t.Fatalf("sampleTree: %v", err)
+	}
+	if sample.size != 5 {
+		t.Errorf("size = %d, want 5", sample.size)
+	}
+	if sample.count != 1 {
+		t.Errorf("count = %d, want 1", sample.count)
+	}
+}
+
+func TestSampleTreeChangesWithContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := sampleTree(dir)
+	if err != nil {
+		t.Fatalf("sampleTree: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("hello, more"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := sampleTree(dir)
+	if err != nil {
+		t.Fatalf("sampleTree: %v", err)
+	}
+
+	if before == after {
+		t.Fatal("sample didn't change after the file grew")
+	}
+}
+
+func TestWaitUntilStableDisabledByDefault(t *testing.T) {
+	w := &Watcher{Rule: Rule{StableChecks: 0}}
+	if err := w.waitUntilStable(t.TempDir()); err != nil {
+		t.Fatalf("waitUntilStable with StableChecks=0: %v", err)
+	}
+}
+
+func TestWaitUntilStableMissingPath(t *testing.T) {
+	w := &Watcher{Rule: Rule{StableChecks: 2, StableInterval: 1}}
+	if err := w.waitUntilStable(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("waitUntilStable on a missing path: want error, got nil")
+	}
+}
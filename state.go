@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedEntry is the on-disk shape of one pending quiescence timer,
+// written to -state on shutdown and read back on startup.
+type persistedEntry struct {
+	Rule      string    `json:"rule"`
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"first_seen"`
+	Deadline  time.Time `json:"deadline"`
+}
+
+// SaveState writes every watcher's pending entries to path as JSON, so a
+// restart doesn't lose track of files that are mid-quiescence. The write
+// goes through a temp file and rename so a crash mid-write can't corrupt
+// the existing state file.
+func SaveState(path string, watchers []*Watcher) error {
+	var entries []persistedEntry
+
+	for _, w := range watchers {
+		w.mu.Lock()
+		for name, entry := range w.timers {
+			entries = append(entries, persistedEntry{
+				Rule:      w.Name,
+				Name:      name,
+				FirstSeen: entry.firstSeen,
+				Deadline:  entry.deadline,
+			})
+		}
+		w.mu.Unlock()
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadState reads a state file written by SaveState. A missing file is
+// not an error: it just means there's nothing to resume.
+func LoadState(path string) ([]persistedEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []persistedEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing state %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// RestoreState re-arms timers for persisted entries whose rule still
+// exists and whose target is still present under the rule's source
+// directory. Entries past their deadline run immediately; the rest get a
+// fresh timer for whatever time remains.
+func RestoreState(entries []persistedEntry, watchers []*Watcher) {
+	byName := make(map[string]*Watcher, len(watchers))
+	for _, w := range watchers {
+		byName[w.Name] = w
+	}
+
+	for _, e := range entries {
+		w, ok := byName[e.Rule]
+		if !ok {
+			continue
+		}
+
+		if !pathExists(filepath.Join(w.Src, e.Name)) {
+			continue
+		}
+
+		w.restoreEntry(e.Name, e.FirstSeen, e.Deadline)
+	}
+}
+
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
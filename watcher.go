@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trackedEntry is the bookkeeping kept for each top-level entry currently
+// waiting out its quiescence window, used both to drive the timer and to
+// answer the admin server's /status endpoint.
+type trackedEntry struct {
+	timer     *time.Timer
+	firstSeen time.Time
+	deadline  time.Time
+	// firing is true from the moment fire() commits to running this
+	// entry's action until it removes the entry from timers. It stops
+	// handleEvent from resetting a timer that has already fired and is
+	// mid-action, which would otherwise arm a second, concurrent fire().
+	firing bool
+}
+
+// Watcher owns all the state for a single rule: its fanotify/inotify mark,
+// the quiescence timers for entries currently being watched, and the
+// policy (wait time, filters, action) to apply once an entry goes quiet.
+type Watcher struct {
+	Rule
+
+	waitFor time.Duration
+
+	mu     sync.Mutex
+	timers map[string]*trackedEntry
+}
+
+// NewWatcher validates a Rule and builds the Watcher that will track it.
+func NewWatcher(r Rule) (*Watcher, error) {
+	if r.Src == "" || r.Dst == "" {
+		return nil, fmt.Errorf("rule %q: src and dst must both be set", r.Name)
+	}
+	if !validateExistingDir(r.Src) || !validateExistingDir(r.Dst) {
+		return nil, fmt.Errorf("rule %q: src and dst must exist and be directories", r.Name)
+	}
+
+	return &Watcher{
+		Rule:    r,
+		waitFor: time.Duration(r.Wait) * time.Second,
+		timers:  make(map[string]*trackedEntry),
+	}, nil
+}
+
+// matches reports whether the watch component name should be tracked,
+// honoring the rule's include/exclude glob patterns. Exclude wins over
+// include when both match.
+func (w *Watcher) matches(name string) bool {
+	if len(w.Include) > 0 {
+		included := false
+		for _, pattern := range w.Include {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, pattern := range w.Exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleEvent is called for every backend event whose path falls under
+// this watcher's source directory. It (re)arms the quiescence timer for
+// the matched top-level entry.
+func (w *Watcher) handleEvent(path string) {
+	name := getWatchComponent(path, w.Src)
+	if name == "" {
+		return
+	}
+	if !w.matches(name) {
+		return
+	}
+
+	w.mu.Lock()
+	entry, ok := w.timers[name]
+	if ok && entry.firing {
+		// fire() already committed to running the action for this entry;
+		// resetting its timer now would just arm a second, concurrent
+		// fire() for the same path. Let the in-flight one finish.
+		w.mu.Unlock()
+		if w.Verbose {
+			fmt.Printf("[%s] %s action already running for %s, ignoring event\n", w.Name, actionLabel(w.Action), name)
+		}
+		return
+	}
+
+	if !ok {
+		if w.Verbose {
+			fmt.Printf("[%s] new content detected, watching: %s\n", w.Name, name)
+		}
+		entry = &trackedEntry{firstSeen: time.Now()}
+		entry.timer = time.AfterFunc(math.MaxInt64, func() { w.fire(name) })
+		entry.timer.Stop()
+		w.timers[name] = entry
+	}
+
+	entry.deadline = time.Now().Add(w.waitFor)
+	w.mu.Unlock()
+
+	if w.Verbose {
+		fmt.Printf("[%s] received an event, resetting the timer for %s\n", w.Name, name)
+	}
+	entry.timer.Reset(w.waitFor)
+}
+
+// fire runs once a timer expires: it performs the rule's action and drops
+// the entry from the tracked set. It's a no-op if the entry is gone or
+// already being handled by another fire() (e.g. one woken up via /flush).
+func (w *Watcher) fire(name string) {
+	w.mu.Lock()
+	entry, ok := w.timers[name]
+	if !ok || entry.firing {
+		w.mu.Unlock()
+		return
+	}
+	entry.firing = true
+	w.mu.Unlock()
+
+	fmt.Printf("[%s] timer expired, running %s action for: %s\n", w.Name, actionLabel(w.Action), name)
+	defer func() { recordWait(time.Since(entry.firstSeen)) }()
+
+	if err := w.waitUntilStable(filepath.Join(w.Src, name)); err != nil {
+		fmt.Printf("[%s] error waiting for %s to stabilize: %v\n", w.Name, name, err)
+		w.mu.Lock()
+		delete(w.timers, name)
+		w.mu.Unlock()
+		return
+	}
+
+	err := w.runAction(name)
+	if err != nil {
+		fmt.Printf("[%s] error running action for %s: %v\n", w.Name, name, err)
+	}
+	recordActionResult(err)
+
+	w.mu.Lock()
+	delete(w.timers, name)
+	w.mu.Unlock()
+}
+
+// restoreEntry re-arms a timer for an entry loaded from the state file.
+// If its deadline has already passed, the action runs right away;
+// otherwise the timer is set for whatever time remains.
+func (w *Watcher) restoreEntry(name string, firstSeen, deadline time.Time) {
+	w.mu.Lock()
+	if _, ok := w.timers[name]; ok {
+		w.mu.Unlock()
+		return
+	}
+
+	entry := &trackedEntry{firstSeen: firstSeen, deadline: deadline}
+	entry.timer = time.AfterFunc(math.MaxInt64, func() { w.fire(name) })
+	entry.timer.Stop()
+	w.timers[name] = entry
+	w.mu.Unlock()
+
+	remaining := time.Until(deadline)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if w.Verbose {
+		fmt.Printf("[%s] resumed %s from state, firing in %s\n", w.Name, name, remaining)
+	}
+	entry.timer.Reset(remaining)
+}
+
+// rescan schedules a fresh timer for every top-level entry already
+// present under Src that isn't already tracked, so files that appeared
+// while the daemon was down aren't missed.
+func (w *Watcher) rescan() error {
+	entries, err := os.ReadDir(w.Src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		w.mu.Lock()
+		_, tracked := w.timers[name]
+		w.mu.Unlock()
+		if tracked {
+			continue
+		}
+
+		w.handleEvent(filepath.Join(w.Src, name))
+	}
+	return nil
+}
+
+// flush cancels name's timer (if any) and immediately runs the rule's
+// action for it, used by the admin server's /flush endpoint. If the
+// timer has already fired naturally (Stop returns false), that fire is
+// left to finish on its own rather than racing a second one against it.
+func (w *Watcher) flush(name string) bool {
+	w.mu.Lock()
+	entry, ok := w.timers[name]
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	if !entry.timer.Stop() {
+		return false
+	}
+
+	go w.fire(name)
+	return true
+}
+
+// cancel drops name's timer without running the rule's action, used by
+// the admin server's /cancel endpoint. If the timer has already fired
+// naturally (Stop returns false), fire owns the entry now, so cancel
+// leaves it alone instead of racing a delete against it.
+func (w *Watcher) cancel(name string) bool {
+	w.mu.Lock()
+	entry, ok := w.timers[name]
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	if !entry.timer.Stop() {
+		return false
+	}
+
+	w.mu.Lock()
+	delete(w.timers, name)
+	w.mu.Unlock()
+	return true
+}
+
+func actionLabel(action string) string {
+	if action == "" {
+		return "move"
+	}
+	return action
+}
+
+// getWatchComponent returns either the filename (if path refers to a file
+// directly under basePath) or the first path component of path relative
+// to basePath (if path is nested in a subdirectory of basePath). It
+// returns "" if path doesn't actually resolve to something under
+// basePath, so callers never mistake "." or ".." for a real entry.
+func getWatchComponent(path, basePath string) string {
+	dir, fname := filepath.Split(path)
+	relPath, err := filepath.Rel(basePath, dir)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	var component string
+	if relPath == "." {
+		component = fname
+	} else {
+		component = strings.Split(relPath, "/")[0]
+	}
+
+	if component == "" || component == "." || component == ".." {
+		return ""
+	}
+	return component
+}